@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"time"
+)
+
+// reconcileInterval is how long the reconciler waits between passes once
+// steady state is reached (both the volume and the network interface held by
+// this instance). In every other state, including holding neither with
+// nothing available to attach, the wait comes from reconcileBackoff instead.
+var reconcileInterval time.Duration
+
+func init() {
+	flag.DurationVar(&reconcileInterval, "reconcile-interval", 60*time.Second, "how often to reconcile once steady state is reached, jittered by up to 20%")
+}
+
+const (
+	backoffMin = 1 * time.Second
+	backoffMax = 30 * time.Second
+)
+
+// reconcileBackoff tracks truncated exponential backoff across reconcile
+// passes while an attach is pending, so retries ramp from backoffMin up to
+// backoffMax instead of hammering the API every pass.
+type reconcileBackoff struct {
+	attempt int
+}
+
+// next returns the delay to wait before the next retry and advances the
+// backoff state.
+func (b *reconcileBackoff) next() time.Duration {
+	delay := backoffMin << uint(b.attempt)
+	if delay > backoffMax || delay <= 0 {
+		delay = backoffMax
+	} else {
+		b.attempt++
+	}
+	return delay
+}
+
+// reset clears the backoff state once steady state is reached.
+func (b *reconcileBackoff) reset() {
+	b.attempt = 0
+}
+
+// jitter returns d adjusted by up to +/-20%, so that a fleet of instances
+// reconciling on the same --reconcile-interval does not all hit the EC2 API
+// at once.
+func jitter(d time.Duration) time.Duration {
+	spread := float64(d) * 0.2
+	offset := (rand.Float64()*2 - 1) * spread
+	return d + time.Duration(offset)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReconcileBackoffNext(t *testing.T) {
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 1 * time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{4, 16 * time.Second},
+		{5, 30 * time.Second},
+		{6, 30 * time.Second},
+		{60, 30 * time.Second},
+	}
+
+	for _, c := range cases {
+		b := reconcileBackoff{attempt: c.attempt}
+		if got := b.next(); got != c.want {
+			t.Errorf("next() with attempt=%d = %v, want %v", c.attempt, got, c.want)
+		}
+	}
+}
+
+func TestReconcileBackoffAdvancesAndCaps(t *testing.T) {
+	var b reconcileBackoff
+	var prev time.Duration
+	for i := 0; i < 10; i++ {
+		d := b.next()
+		if d > backoffMax {
+			t.Fatalf("next() = %v, exceeds backoffMax %v", d, backoffMax)
+		}
+		if d < prev {
+			t.Fatalf("next() = %v, shorter than previous delay %v", d, prev)
+		}
+		prev = d
+	}
+	if prev != backoffMax {
+		t.Errorf("last delay = %v, want it capped at backoffMax %v", prev, backoffMax)
+	}
+}
+
+func TestReconcileBackoffReset(t *testing.T) {
+	b := reconcileBackoff{attempt: 5}
+	b.reset()
+	if got := b.next(); got != backoffMin {
+		t.Errorf("next() after reset = %v, want %v", got, backoffMin)
+	}
+}
+
+func TestJitterWithinSpread(t *testing.T) {
+	d := 60 * time.Second
+	spread := time.Duration(float64(d) * 0.2)
+
+	for i := 0; i < 1000; i++ {
+		got := jitter(d)
+		if got < d-spread || got > d+spread {
+			t.Fatalf("jitter(%v) = %v, outside +/-20%% spread", d, got)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// CloudProvider abstracts the volume and network interface operations that
+// smilodon needs in order to move a workload's storage and networking
+// between instances. It exists so that the reconciler in run() does not need
+// to know whether it is talking to AWS or another cloud; nodeID pairing
+// semantics are identical across implementations.
+type CloudProvider interface {
+	// DiscoverVolumes returns the volumes matching the configured filters,
+	// along with their attachment state.
+	DiscoverVolumes(i *instance) ([]volume, error)
+
+	// DiscoverNICs returns the network interfaces matching the configured
+	// filters, along with their attachment state.
+	DiscoverNICs(i *instance) ([]networkInterface, error)
+
+	// AttachVolume attaches v to i at the given block device index.
+	AttachVolume(ctx context.Context, i *instance, v volume, deviceIndex int) error
+
+	// AttachNIC attaches n to i at the given network device index.
+	AttachNIC(ctx context.Context, i *instance, n networkInterface, deviceIndex int) error
+
+	// DetachVolume detaches v from i.
+	DetachVolume(ctx context.Context, i *instance, v volume) error
+
+	// DetachNIC detaches n from i.
+	DetachNIC(ctx context.Context, i *instance, n networkInterface) error
+
+	// AttachNICExtras restores any secondary private IPs and Elastic IP
+	// association described by n's tags, once n is attached to i. Providers
+	// that do not support such extras (or do not yet surface the tags that
+	// describe them) may implement this as a no-op.
+	AttachNICExtras(ctx context.Context, n networkInterface) error
+
+	// DetachNICExtras releases the secondary IPs and Elastic IP association
+	// set up by AttachNICExtras, before n is detached from i.
+	DetachNICExtras(ctx context.Context, n networkInterface) error
+
+	// InstanceMetadata returns the identifying properties of the instance
+	// smilodon is running on (id, region, availability zone, ...).
+	InstanceMetadata(ctx context.Context) (instance, error)
+
+	// AcquireLease records i as the best-effort holder of v for
+	// leaseDuration, refusing to do so if another instance's lease on v is
+	// still outstanding. This is advisory, not a true compare-and-swap: the
+	// backing store (e.g. EC2 tags) has no atomic conditional write, so two
+	// instances racing within the same read/write window can both succeed.
+	AcquireLease(ctx context.Context, i *instance, v volume) error
+
+	// ReleaseLease clears i's lease on v so a peer does not have to wait out
+	// the remainder of leaseDuration before attaching.
+	ReleaseLease(ctx context.Context, i *instance, v volume) error
+
+	// WaitVolumeAvailable blocks until v reports available, or ctx expires.
+	WaitVolumeAvailable(ctx context.Context, v volume) error
+}
+
+// newCloudProvider selects a CloudProvider based on the --cloud flag,
+// falling back to metadata-based auto-detection when cloud is "auto".
+func newCloudProvider(cloud string) (CloudProvider, error) {
+	switch cloud {
+	case "aws", "":
+		return &ec2Provider{client: ec2c, filters: filters}, nil
+	case "openstack":
+		return newOpenStackProvider()
+	case "auto":
+		return detectCloudProvider()
+	default:
+		return nil, fmt.Errorf("unsupported --cloud value %q", cloud)
+	}
+}
+
+// detectCloudProvider probes the well-known metadata endpoints to figure out
+// which cloud smilodon is running on.
+func detectCloudProvider() (CloudProvider, error) {
+	if isEC2Metadata() {
+		return &ec2Provider{client: ec2c, filters: filters}, nil
+	}
+	if isOpenStackMetadata() {
+		return newOpenStackProvider()
+	}
+	return nil, fmt.Errorf("could not auto-detect cloud provider from instance metadata")
+}
+
+// volumeDeviceIndex is the block device index volumes are attached at; EC2
+// and Cinder both pick the device node from the host's next-free slot, so
+// unlike the ENI's --nic-device-index there is no need to make this
+// configurable.
+const volumeDeviceIndex = 1
+
+// isEC2Metadata reports whether the EC2 instance metadata service is
+// reachable, used by --cloud=auto.
+func isEC2Metadata() bool {
+	resp, err := http.Get("http://169.254.169.254/latest/meta-data/instance-id")
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// ec2Provider is the CloudProvider backed by the existing EC2 volume/ENI
+// logic. It is a thin wrapper so that callers go through the CloudProvider
+// interface instead of the package-level functions directly.
+type ec2Provider struct {
+	client  *ec2.EC2
+	filters []*ec2.Filter
+}
+
+func (p *ec2Provider) DiscoverVolumes(i *instance) ([]volume, error) {
+	return findVolumes(i, p.client, p.filters)
+}
+
+func (p *ec2Provider) DiscoverNICs(i *instance) ([]networkInterface, error) {
+	return findNetworkInterfaces(i, p.client, p.filters)
+}
+
+func (p *ec2Provider) AttachVolume(ctx context.Context, i *instance, v volume, deviceIndex int) error {
+	err := i.attachVolume(v, p.client)
+	observeAttachAttempt("volume", err)
+	if err != nil {
+		return err
+	}
+	return p.client.WaitUntilVolumeInUseWithContext(ctx, &ec2.DescribeVolumesInput{
+		VolumeIds: []*string{aws.String(v.id)},
+	})
+}
+
+func (p *ec2Provider) AttachNIC(ctx context.Context, i *instance, n networkInterface, deviceIndex int) error {
+	if err := p.client.WaitUntilNetworkInterfaceAvailableWithContext(ctx, &ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: []*string{aws.String(n.id)},
+	}); err != nil {
+		observeAttachAttempt("network_interface", err)
+		return err
+	}
+
+	existing, err := p.nicAtDeviceIndex(ctx, i.id, deviceIndex)
+	if err != nil {
+		observeAttachAttempt("network_interface", err)
+		return fmt.Errorf("checking device index %d on %q: %w", deviceIndex, i.id, err)
+	}
+	if existing != "" {
+		if !nicCfg.allowReassign {
+			err := fmt.Errorf("device index %d on %q is already in use by %q, refusing to attach %q (set --nic-allow-reassign to override)", deviceIndex, i.id, existing, n.id)
+			observeAttachAttempt("network_interface", err)
+			return err
+		}
+		if _, err := p.client.DetachNetworkInterfaceWithContext(ctx, &ec2.DetachNetworkInterfaceInput{
+			AttachmentId: aws.String(existing),
+		}); err != nil {
+			observeAttachAttempt("network_interface", err)
+			return fmt.Errorf("detaching existing network interface at device index %d: %w", deviceIndex, err)
+		}
+		if err := p.waitDeviceIndexFree(ctx, i.id, deviceIndex); err != nil {
+			observeAttachAttempt("network_interface", err)
+			return fmt.Errorf("waiting for device index %d on %q to clear: %w", deviceIndex, i.id, err)
+		}
+	}
+
+	err = i.attachNetworkInterface(n, p.client, deviceIndex)
+	observeAttachAttempt("network_interface", err)
+	return err
+}
+
+// nicAtDeviceIndex returns the attachment ID of the network interface
+// already attached to instanceID at deviceIndex, or "" if the slot is free.
+func (p *ec2Provider) nicAtDeviceIndex(ctx context.Context, instanceID string, deviceIndex int) (string, error) {
+	out, err := p.client.DescribeNetworkInterfacesWithContext(ctx, &ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("attachment.instance-id"), Values: []*string{aws.String(instanceID)}},
+			{Name: aws.String("attachment.device-index"), Values: []*string{aws.String(fmt.Sprintf("%d", deviceIndex))}},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(out.NetworkInterfaces) == 0 || out.NetworkInterfaces[0].Attachment == nil {
+		return "", nil
+	}
+	return aws.StringValue(out.NetworkInterfaces[0].Attachment.AttachmentId), nil
+}
+
+// nicDeviceIndexPollInterval is how often waitDeviceIndexFree re-checks a
+// vacated device index; the EC2 SDK has no waiter for "attachment gone".
+const nicDeviceIndexPollInterval = 2 * time.Second
+
+// waitDeviceIndexFree blocks until instanceID's deviceIndex has no
+// attachment, so a --nic-allow-reassign detach-then-attach does not race
+// the asynchronous EC2 detach.
+func (p *ec2Provider) waitDeviceIndexFree(ctx context.Context, instanceID string, deviceIndex int) error {
+	for {
+		existing, err := p.nicAtDeviceIndex(ctx, instanceID, deviceIndex)
+		if err != nil {
+			return err
+		}
+		if existing == "" {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(nicDeviceIndexPollInterval):
+		}
+	}
+}
+
+func (p *ec2Provider) DetachVolume(ctx context.Context, i *instance, v volume) error {
+	_, err := p.client.DetachVolumeWithContext(ctx, &ec2.DetachVolumeInput{
+		VolumeId:   aws.String(v.id),
+		InstanceId: aws.String(i.id),
+	})
+	return err
+}
+
+func (p *ec2Provider) DetachNIC(ctx context.Context, i *instance, n networkInterface) error {
+	_, err := p.client.DetachNetworkInterfaceWithContext(ctx, &ec2.DetachNetworkInterfaceInput{
+		AttachmentId: aws.String(n.attachmentID),
+	})
+	return err
+}
+
+func (p *ec2Provider) InstanceMetadata(ctx context.Context) (instance, error) {
+	var i instance
+	err := i.getMetadata()
+	return i, err
+}
+
+// holderTagKey is the EC2 tag used to record the best-effort lease holder
+// of a volume (see CloudProvider.AcquireLease).
+const holderTagKey = "smilodon/holder"
+
+func (p *ec2Provider) AcquireLease(ctx context.Context, i *instance, v volume) error {
+	// Re-read the tag immediately before writing to narrow the race window
+	// against a concurrent holder, though CreateTags has no CAS semantics
+	// so this remains best-effort, not a true fencing guarantee.
+	out, err := p.client.DescribeVolumesWithContext(ctx, &ec2.DescribeVolumesInput{
+		VolumeIds: []*string{aws.String(v.id)},
+	})
+	if err != nil {
+		return fmt.Errorf("re-reading tags on volume %q: %w", v.id, err)
+	}
+	if len(out.Volumes) == 0 {
+		return fmt.Errorf("volume %q not found", v.id)
+	}
+
+	var current string
+	for _, tag := range out.Volumes[0].Tags {
+		if aws.StringValue(tag.Key) == holderTagKey {
+			current = aws.StringValue(tag.Value)
+		}
+	}
+
+	if held, holder, err := holderStillValid(current, i.id); err != nil {
+		return fmt.Errorf("parsing %s tag on %q: %w", holderTagKey, v.id, err)
+	} else if held {
+		return fmt.Errorf("volume %q is held by %q, refusing to attach", v.id, holder)
+	}
+
+	value := formatHolderTag(i.id, time.Now().Add(leaseDuration))
+	_, err = p.client.CreateTagsWithContext(ctx, &ec2.CreateTagsInput{
+		Resources: []*string{aws.String(v.id)},
+		Tags:      []*ec2.Tag{{Key: aws.String(holderTagKey), Value: aws.String(value)}},
+	})
+	return err
+}
+
+func (p *ec2Provider) ReleaseLease(ctx context.Context, i *instance, v volume) error {
+	_, err := p.client.CreateTagsWithContext(ctx, &ec2.CreateTagsInput{
+		Resources: []*string{aws.String(v.id)},
+		Tags:      []*ec2.Tag{{Key: aws.String(holderTagKey), Value: aws.String("")}},
+	})
+	return err
+}
+
+func (p *ec2Provider) WaitVolumeAvailable(ctx context.Context, v volume) error {
+	return p.client.WaitUntilVolumeAvailableWithContext(ctx, &ec2.DescribeVolumesInput{
+		VolumeIds: []*string{aws.String(v.id)},
+	})
+}
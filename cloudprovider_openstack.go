@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/gophercloud/gophercloud"
+	"github.com/gophercloud/gophercloud/openstack"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/extensions/volumeactions"
+	"github.com/gophercloud/gophercloud/openstack/blockstorage/v3/volumes"
+	"github.com/gophercloud/gophercloud/openstack/networking/v2/ports"
+)
+
+const openStackMetadataURL = "http://169.254.169.254/openstack/latest/meta_data.json"
+
+// volumePollInterval is how often WaitVolumeAvailable polls Cinder, which
+// has no server-side waiter equivalent to the EC2 SDK's.
+const volumePollInterval = 2 * time.Second
+
+// openStackMetadata is the subset of the Nova metadata service response that
+// smilodon cares about.
+type openStackMetadata struct {
+	UUID string `json:"uuid"`
+}
+
+func getOpenStackMetadata() (*openStackMetadata, error) {
+	resp, err := http.Get(openStackMetadataURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var md openStackMetadata
+	if err := json.Unmarshal(body, &md); err != nil {
+		return nil, err
+	}
+	return &md, nil
+}
+
+// openStackProvider is the CloudProvider implementation for OpenStack. It
+// drives Cinder volume attachments through volumeactions and Neutron ports
+// through the compute os-interface API.
+type openStackProvider struct {
+	compute *gophercloud.ServiceClient
+	block   *gophercloud.ServiceClient
+	network *gophercloud.ServiceClient
+}
+
+func newOpenStackProvider() (*openStackProvider, error) {
+	authOpts, err := openstack.AuthOptionsFromEnv()
+	if err != nil {
+		return nil, fmt.Errorf("reading OpenStack auth options from environment: %w", err)
+	}
+	provider, err := openstack.AuthenticatedClient(authOpts)
+	if err != nil {
+		return nil, fmt.Errorf("authenticating with OpenStack: %w", err)
+	}
+
+	endpoint := gophercloud.EndpointOpts{Region: region}
+	compute, err := openstack.NewComputeV2(provider, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("creating OpenStack compute client: %w", err)
+	}
+	block, err := openstack.NewBlockStorageV3(provider, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("creating OpenStack block storage client: %w", err)
+	}
+	network, err := openstack.NewNetworkV2(provider, endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("creating OpenStack network client: %w", err)
+	}
+
+	return &openStackProvider{compute: compute, block: block, network: network}, nil
+}
+
+func (p *openStackProvider) DiscoverVolumes(i *instance) ([]volume, error) {
+	pages, err := volumes.List(p.block, volumes.ListOpts{}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("listing Cinder volumes: %w", err)
+	}
+	vols, err := volumes.ExtractVolumes(pages)
+	if err != nil {
+		return nil, fmt.Errorf("extracting Cinder volumes: %w", err)
+	}
+
+	var found []volume
+	for _, v := range vols {
+		nodeID, ok := v.Metadata["smilodon/node-id"]
+		if !ok {
+			continue
+		}
+		var attachedTo string
+		if len(v.Attachments) > 0 {
+			attachedTo = v.Attachments[0].ServerID
+		}
+		found = append(found, volume{
+			id:         v.ID,
+			nodeID:     nodeID,
+			attachedTo: attachedTo,
+			available:  v.Status == "available",
+		})
+	}
+	return found, nil
+}
+
+func (p *openStackProvider) DiscoverNICs(i *instance) ([]networkInterface, error) {
+	pages, err := ports.List(p.network, ports.ListOpts{}).AllPages()
+	if err != nil {
+		return nil, fmt.Errorf("listing Neutron ports: %w", err)
+	}
+	found, err := ports.ExtractPorts(pages)
+	if err != nil {
+		return nil, fmt.Errorf("extracting Neutron ports: %w", err)
+	}
+
+	var nics []networkInterface
+	for _, port := range found {
+		if len(port.Tags) == 0 {
+			continue
+		}
+		nics = append(nics, networkInterface{
+			id:         port.ID,
+			nodeID:     port.Tags[0],
+			attachedTo: port.DeviceID,
+			available:  port.DeviceID == "",
+		})
+	}
+	return nics, nil
+}
+
+func (p *openStackProvider) AttachVolume(ctx context.Context, i *instance, v volume, deviceIndex int) error {
+	opts := volumeactions.AttachOpts{
+		MountPoint:   deviceName(deviceIndex),
+		Mode:         "rw",
+		InstanceUUID: i.id,
+	}
+	return volumeactions.Attach(p.block, v.id, opts).ExtractErr()
+}
+
+// AttachNIC attaches n to i. Neutron's os-interface API has no concept of a
+// device index, so deviceIndex is accepted only to satisfy the
+// CloudProvider interface and is otherwise unused on this provider.
+func (p *openStackProvider) AttachNIC(ctx context.Context, i *instance, n networkInterface, deviceIndex int) error {
+	_, err := p.compute.Post("servers/"+i.id+"/os-interface", map[string]interface{}{
+		"interfaceAttachment": map[string]interface{}{
+			"port_id": n.id,
+		},
+	}, nil, nil)
+	return err
+}
+
+func (p *openStackProvider) DetachVolume(ctx context.Context, i *instance, v volume) error {
+	return volumeactions.Detach(p.block, v.id, volumeactions.DetachOpts{}).ExtractErr()
+}
+
+func (p *openStackProvider) DetachNIC(ctx context.Context, i *instance, n networkInterface) error {
+	_, err := p.compute.Delete("servers/"+i.id+"/os-interface/"+n.id, nil)
+	return err
+}
+
+// AttachNICExtras is a no-op on this provider: DiscoverNICs does not yet
+// surface secondary-IP/EIP equivalents via port tags, so there is nothing
+// to restore. It is not wired up to assume Neutron semantics match EC2's.
+func (p *openStackProvider) AttachNICExtras(ctx context.Context, n networkInterface) error {
+	return nil
+}
+
+// DetachNICExtras is a no-op for the same reason as AttachNICExtras.
+func (p *openStackProvider) DetachNICExtras(ctx context.Context, n networkInterface) error {
+	return nil
+}
+
+func (p *openStackProvider) InstanceMetadata(ctx context.Context) (instance, error) {
+	md, err := getOpenStackMetadata()
+	if err != nil {
+		return instance{}, fmt.Errorf("getting OpenStack instance metadata: %w", err)
+	}
+	return instance{id: md.UUID, region: region}, nil
+}
+
+// holderMetadataKey is the Cinder volume metadata key used to record the
+// best-effort lease holder of a volume (see CloudProvider.AcquireLease).
+const holderMetadataKey = "smilodon-holder"
+
+func (p *openStackProvider) AcquireLease(ctx context.Context, i *instance, v volume) error {
+	// Re-read the metadata immediately before writing to narrow the race
+	// window against a concurrent holder; Cinder's metadata update has no
+	// CAS semantics either, so this remains best-effort, not a true
+	// fencing guarantee.
+	vol, err := volumes.Get(p.block, v.id).Extract()
+	if err != nil {
+		return fmt.Errorf("re-reading metadata on volume %q: %w", v.id, err)
+	}
+
+	if held, holder, err := holderStillValid(vol.Metadata[holderMetadataKey], i.id); err != nil {
+		return fmt.Errorf("parsing %s metadata on %q: %w", holderMetadataKey, v.id, err)
+	} else if held {
+		return fmt.Errorf("volume %q is held by %q, refusing to attach", v.id, holder)
+	}
+
+	value := formatHolderTag(i.id, time.Now().Add(leaseDuration))
+	metadata := vol.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata[holderMetadataKey] = value
+	_, err = volumes.Update(p.block, v.id, volumes.UpdateOpts{Metadata: metadata}).Extract()
+	return err
+}
+
+func (p *openStackProvider) ReleaseLease(ctx context.Context, i *instance, v volume) error {
+	vol, err := volumes.Get(p.block, v.id).Extract()
+	if err != nil {
+		return fmt.Errorf("re-reading metadata on volume %q: %w", v.id, err)
+	}
+
+	metadata := vol.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	metadata[holderMetadataKey] = ""
+	_, err = volumes.Update(p.block, v.id, volumes.UpdateOpts{Metadata: metadata}).Extract()
+	return err
+}
+
+func (p *openStackProvider) WaitVolumeAvailable(ctx context.Context, v volume) error {
+	for {
+		vol, err := volumes.Get(p.block, v.id).Extract()
+		if err != nil {
+			return fmt.Errorf("polling volume %q status: %w", v.id, err)
+		}
+		if vol.Status == "available" {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(volumePollInterval):
+		}
+	}
+}
+
+// isOpenStackMetadata reports whether the OpenStack metadata service is
+// reachable, used by --cloud=auto.
+func isOpenStackMetadata() bool {
+	resp, err := http.Get(openStackMetadataURL)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+// deviceName maps a device index to the conventional Cinder mountpoint,
+// e.g. 0 -> /dev/vdb, 1 -> /dev/vdc.
+func deviceName(index int) string {
+	return fmt.Sprintf("/dev/vd%c", 'b'+byte(index))
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestDeviceName(t *testing.T) {
+	cases := []struct {
+		index int
+		want  string
+	}{
+		{0, "/dev/vdb"},
+		{1, "/dev/vdc"},
+		{2, "/dev/vdd"},
+	}
+
+	for _, c := range cases {
+		if got := deviceName(c.index); got != c.want {
+			t.Errorf("deviceName(%d) = %q, want %q", c.index, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// nicOpts holds the flags that control how the ENI is attached, and whether
+// smilodon should take over the device index of an already-attached ENI.
+type nicOpts struct {
+	deviceIndex   int
+	allowReassign bool
+}
+
+var nicCfg nicOpts
+
+func init() {
+	flag.IntVar(&nicCfg.deviceIndex, "nic-device-index", 1, "device index to attach the network interface at")
+	flag.BoolVar(&nicCfg.allowReassign, "nic-allow-reassign", false, "allow attaching even if the device index is already in use on the instance")
+}
+
+const (
+	secondaryIPsTag    = "smilodon/secondary-ips"
+	eipAllocationIDTag = "smilodon/eip-allocation-id"
+)
+
+// AttachNICExtras moves the secondary private IPs and Elastic IP association
+// described by n's tags onto the ENI, after it has been attached to i, so
+// failover preserves the public IP and secondary IPs bound to the floating
+// ENI.
+func (p *ec2Provider) AttachNICExtras(ctx context.Context, n networkInterface) error {
+	if ips, ok := n.tags[secondaryIPsTag]; ok && ips != "" {
+		if err := p.assignSecondaryIPs(ctx, n.id, strings.Split(ips, ",")); err != nil {
+			return fmt.Errorf("assigning secondary IPs to %q: %w", n.id, err)
+		}
+	}
+
+	if allocationID, ok := n.tags[eipAllocationIDTag]; ok && allocationID != "" {
+		if err := p.associateElasticIP(ctx, n.id, allocationID); err != nil {
+			return fmt.Errorf("associating Elastic IP %q with %q: %w", allocationID, n.id, err)
+		}
+	}
+
+	return nil
+}
+
+// DetachNICExtras unassigns the secondary private IPs and disassociates the
+// Elastic IP on detach, so they are free for the ENI to be re-attached to
+// the next instance.
+func (p *ec2Provider) DetachNICExtras(ctx context.Context, n networkInterface) error {
+	if ips, ok := n.tags[secondaryIPsTag]; ok && ips != "" {
+		if err := p.unassignSecondaryIPs(ctx, n.id, strings.Split(ips, ",")); err != nil {
+			return fmt.Errorf("unassigning secondary IPs from %q: %w", n.id, err)
+		}
+	}
+
+	if allocationID, ok := n.tags[eipAllocationIDTag]; ok && allocationID != "" {
+		if err := p.disassociateElasticIP(ctx, allocationID); err != nil {
+			return fmt.Errorf("disassociating Elastic IP %q: %w", allocationID, err)
+		}
+	}
+
+	return nil
+}
+
+func (p *ec2Provider) assignSecondaryIPs(ctx context.Context, eniID string, ips []string) error {
+	_, err := p.client.AssignPrivateIpAddressesWithContext(ctx, &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String(eniID),
+		PrivateIpAddresses: aws.StringSlice(ips),
+	})
+	return err
+}
+
+func (p *ec2Provider) unassignSecondaryIPs(ctx context.Context, eniID string, ips []string) error {
+	_, err := p.client.UnassignPrivateIpAddressesWithContext(ctx, &ec2.UnassignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String(eniID),
+		PrivateIpAddresses: aws.StringSlice(ips),
+	})
+	return err
+}
+
+func (p *ec2Provider) associateElasticIP(ctx context.Context, eniID, allocationID string) error {
+	_, err := p.client.AssociateAddressWithContext(ctx, &ec2.AssociateAddressInput{
+		NetworkInterfaceId: aws.String(eniID),
+		AllocationId:       aws.String(allocationID),
+	})
+	return err
+}
+
+func (p *ec2Provider) disassociateElasticIP(ctx context.Context, allocationID string) error {
+	addrs, err := p.client.DescribeAddressesWithContext(ctx, &ec2.DescribeAddressesInput{
+		AllocationIds: []*string{aws.String(allocationID)},
+	})
+	if err != nil {
+		return err
+	}
+	if len(addrs.Addresses) == 0 || addrs.Addresses[0].AssociationId == nil {
+		return nil
+	}
+
+	_, err = p.client.DisassociateAddressWithContext(ctx, &ec2.DisassociateAddressInput{
+		AssociationId: addrs.Addresses[0].AssociationId,
+	})
+	return err
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
@@ -8,6 +9,8 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -20,6 +23,7 @@ type cmdLineOpts struct {
 	mountPoint  string
 	help        bool
 	version     bool
+	cloud       string
 }
 
 var (
@@ -39,6 +43,7 @@ func init() {
 	flag.StringVar(&opts.mountPoint, "mount-point", "/data", "mount point path")
 	flag.BoolVar(&opts.help, "help", false, "print this message")
 	flag.BoolVar(&opts.version, "version", false, "print version and exit")
+	flag.StringVar(&opts.cloud, "cloud", "auto", "cloud provider to use: aws, openstack, or auto to detect from instance metadata")
 }
 
 func main() {
@@ -63,27 +68,63 @@ func main() {
 	ec2c = ec2.New(session.New(), aws.NewConfig().WithRegion(i.region))
 	filters = buildFilters(i)
 
-	for {
-		run(&i)
-		time.Sleep(10 * time.Second)
+	cloud, err := newCloudProvider(opts.cloud)
+	if err != nil {
+		log.Fatalf("Issues selecting a cloud provider: %s.", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	startMetricsServer()
+
+	var backoff reconcileBackoff
+	for ctx.Err() == nil {
+		start := time.Now()
+		run(ctx, &i, cloud)
+		reconcileDurationSeconds.Observe(time.Since(start).Seconds())
+		recordResourceState(&i)
+
+		wait := jitter(reconcileInterval)
+		if i.volume == nil || i.networkInterface == nil {
+			wait = backoff.next()
+		} else {
+			backoff.reset()
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+	}
+
+	log.Println("Received shutdown signal, detaching volume and network interface before exiting.")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := shutdown(shutdownCtx, &i, cloud); err != nil {
+		log.Printf("Error during graceful shutdown: %s.", err)
+		os.Exit(1)
 	}
 }
 
-func run(i *instance) {
+func run(ctx context.Context, i *instance, cloud CloudProvider) {
 	// Iterate over found volumes and check if one of them is attached to the
 	// instance, then update i.volume accordingly.
-	volumes, err := findVolumes(i, ec2c, filters)
+	volumes, err := cloud.DiscoverVolumes(i)
 	if err != nil {
 		log.Println(err)
 	} else {
 		for _, v := range volumes {
 			if i.volume == nil && v.attachedTo == i.id {
 				log.Printf("Found attached volume: %q.\n", v.id)
-				if opts.createFS {
+				if opts.createFs {
 					if !hasFs(opts.blockDevice, opts.fsType) {
 						mkfs(opts.blockDevice, opts.fsType)
 
 					}
+					if err := mountOverlay(); err != nil {
+						log.Println(err)
+					}
 				}
 				i.volume = &v
 				break
@@ -97,7 +138,7 @@ func run(i *instance) {
 
 	// Iterate over found network interfaces and see if one of them is attached
 	// to the instance, then update i.networkInterface accordingly.
-	networkInterfaces, err := findNetworkInterfaces(i, ec2c, filters)
+	networkInterfaces, err := cloud.DiscoverNICs(i)
 	if err != nil {
 		log.Println(err)
 	} else {
@@ -105,12 +146,30 @@ func run(i *instance) {
 			if i.networkInterface == nil && n.attachedTo == i.id {
 				log.Printf("Found attached network interface: %q.\n", n.id)
 				i.networkInterface = &n
+				if err := reconcileNetns(n); err != nil {
+					log.Println(err)
+				}
 				break
 			}
 			if i.networkInterface != nil && i.networkInterface.id == n.id && n.available {
+				if err := restoreNetns(*i.networkInterface); err != nil {
+					log.Println(err)
+				}
 				i.networkInterface = nil
 				break
 			}
+			if i.networkInterface != nil && i.networkInterface.id == n.id && !n.available {
+				// Steady state: heal any drift (link pushed back to the root
+				// netns, address removed, secondary IPs/EIP unassigned)
+				// since the last reconcile pass.
+				if err := reconcileNetns(n); err != nil {
+					log.Println(err)
+				}
+				if err := cloud.AttachNICExtras(ctx, n); err != nil {
+					log.Println(err)
+				}
+				break
+			}
 		}
 	}
 
@@ -120,10 +179,17 @@ func run(i *instance) {
 		log.Println("Neither a volume, nor a network interface are attached.")
 		for _, v := range volumes {
 			if v.available {
-				if err := i.attachVolume(v, ec2c); err == nil {
+				if err := cloud.AcquireLease(ctx, i, v); err != nil {
+					log.Println(err)
+					break
+				}
+				if err := cloud.AttachVolume(ctx, i, v, volumeDeviceIndex); err == nil {
 					if opts.createFs && !hasFs(opts.blockDevice, opts.fsType) {
 						mkfs(opts.blockDevice, opts.fsType)
 					}
+					if err := mountOverlay(); err != nil {
+						log.Println(err)
+					}
 				}
 				break
 			}
@@ -134,7 +200,13 @@ func run(i *instance) {
 		if i.volume != nil {
 			for _, n := range networkInterfaces {
 				if n.available && i.volume.nodeID == n.nodeID {
-					_ = i.attachNetworkInterface(n, ec2c)
+					_ = cloud.AttachNIC(ctx, i, n, nicCfg.deviceIndex)
+					if err := reconcileNetns(n); err != nil {
+						log.Println(err)
+					}
+					if err := cloud.AttachNICExtras(ctx, n); err != nil {
+						log.Println(err)
+					}
 					break
 				}
 				log.Println("No available network interfaces found.")
@@ -149,7 +221,13 @@ func run(i *instance) {
 	if i.volume != nil && i.networkInterface == nil {
 		for _, n := range networkInterfaces {
 			if n.available && n.nodeID == i.volume.nodeID {
-				_ = i.attachNetworkInterface(n, ec2c)
+				_ = cloud.AttachNIC(ctx, i, n, nicCfg.deviceIndex)
+				if err := reconcileNetns(n); err != nil {
+					log.Println(err)
+				}
+				if err := cloud.AttachNICExtras(ctx, n); err != nil {
+					log.Println(err)
+				}
 				break
 			}
 		}
@@ -161,18 +239,33 @@ func run(i *instance) {
 		for _, v := range volumes {
 			if v.available && v.nodeID == i.networkInterface.nodeID {
 				log.Printf("Found a matching volume %q with NodeID %q.\n", v.id, v.nodeID)
-				_ = i.attachVolume(v, ec2c)
-				if opts.createFS {
+				if err := cloud.AcquireLease(ctx, i, v); err != nil {
+					log.Println(err)
+					break
+				}
+				_ = cloud.AttachVolume(ctx, i, v, volumeDeviceIndex)
+				if opts.createFs {
 					if !hasFs(opts.blockDevice, opts.fsType) {
 						mkfs(opts.blockDevice, opts.fsType)
 
 					}
+					if err := mountOverlay(); err != nil {
+						log.Println(err)
+					}
 				}
 				break
 			}
 		}
 	}
 
+	// Refresh the best-effort lease each reconcile pass so peers know this
+	// instance is still the holder of the volume.
+	if i.volume != nil {
+		if err := cloud.AcquireLease(ctx, i, *i.volume); err != nil {
+			log.Println(err)
+		}
+	}
+
 	// Set nodeID only when both volume and network interface are attached and their node IDs match.
 	if i.volume != nil && i.networkInterface != nil {
 		if i.volume.nodeID == i.networkInterface.nodeID {
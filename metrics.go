@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var metricsAddr string
+
+func init() {
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "address to serve Prometheus metrics on, e.g. :9090; disabled if empty")
+}
+
+var (
+	attachAttemptsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "smilodon_attach_attempts_total",
+		Help: "Total number of volume/NIC attach attempts, by resource and outcome.",
+	}, []string{"resource", "outcome"})
+
+	reconcileDurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name: "smilodon_reconcile_duration_seconds",
+		Help: "Duration of a single reconcile pass.",
+	})
+
+	volumeState = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "smilodon_volume_state",
+		Help: "Whether this instance currently holds the volume (1) or not (0).",
+	})
+
+	nicState = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "smilodon_nic_state",
+		Help: "Whether this instance currently holds the network interface (1) or not (0).",
+	})
+)
+
+// startMetricsServer serves the /metrics endpoint in the background if
+// --metrics-addr is set. It is a no-op otherwise.
+func startMetricsServer() {
+	if metricsAddr == "" {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	go func() {
+		if err := http.ListenAndServe(metricsAddr, mux); err != nil {
+			log.Printf("Metrics server exited: %s.", err)
+		}
+	}()
+}
+
+func observeAttachAttempt(resource string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	attachAttemptsTotal.WithLabelValues(resource, outcome).Inc()
+}
+
+func recordResourceState(i *instance) {
+	state := float64(0)
+	if i.volume != nil {
+		state = 1
+	}
+	volumeState.Set(state)
+
+	state = 0
+	if i.networkInterface != nil {
+		state = 1
+	}
+	nicState.Set(state)
+}
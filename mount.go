@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// isMounted reports whether path is currently a mount point, by scanning
+// /proc/self/mountinfo.
+func isMounted(path string) (bool, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		if fields[4] == path {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// unmountFs unmounts path if it is currently mounted; it is a no-op
+// otherwise so that it is safe to call unconditionally during shutdown.
+func unmountFs(path string) error {
+	mounted, err := isMounted(path)
+	if err != nil {
+		return fmt.Errorf("checking mount state of %q: %w", path, err)
+	}
+	if !mounted {
+		return nil
+	}
+	if err := syscall.Unmount(path, 0); err != nil {
+		return fmt.Errorf("unmounting %q: %w", path, err)
+	}
+	return nil
+}
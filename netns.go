@@ -0,0 +1,250 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"runtime"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// netnsOpts holds the flags that control moving the attached ENI's link
+// into a dedicated network namespace.
+type netnsOpts struct {
+	name         string
+	move         bool
+	defaultRoute string
+}
+
+var netnsCfg netnsOpts
+
+func init() {
+	flag.StringVar(&netnsCfg.name, "netns-name", "smilodon", "name of the network namespace the attached ENI's link is moved into")
+	flag.BoolVar(&netnsCfg.move, "netns-move", false, "whether to move the attached ENI's link into --netns-name")
+	flag.StringVar(&netnsCfg.defaultRoute, "netns-default-route", "", "default route to install inside --netns-name, e.g. 10.0.0.1")
+}
+
+// reconcileNetns ensures the link belonging to n is present inside the
+// target netns with the addresses and default route described by n. It is
+// idempotent: repeated calls with the same network interface state are a
+// no-op once the desired state is reached.
+func reconcileNetns(n networkInterface) error {
+	if !netnsCfg.move {
+		return nil
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	rootNs, err := netns.Get()
+	if err != nil {
+		return fmt.Errorf("getting root netns: %w", err)
+	}
+	defer rootNs.Close()
+
+	targetNs, err := ensureNetns(netnsCfg.name)
+	if err != nil {
+		return fmt.Errorf("ensuring netns %q: %w", netnsCfg.name, err)
+	}
+	defer targetNs.Close()
+
+	link, err := findLinkByMAC(n.macAddress)
+	if err != nil {
+		return fmt.Errorf("finding link for ENI %q: %w", n.id, err)
+	}
+
+	if link == nil {
+		// The link may already live in the target namespace from a previous
+		// reconcile pass; nothing more to do if its addresses are already
+		// set up there.
+		if inTargetNs, err := linkExistsInNetns(netnsCfg.name, n.macAddress); err == nil && inTargetNs {
+			return configureNetnsLink(targetNs, n)
+		}
+		return fmt.Errorf("link for ENI %q not found in root namespace", n.id)
+	}
+
+	if err := netlink.LinkSetNsFd(link, int(targetNs)); err != nil {
+		return fmt.Errorf("moving link %q into netns %q: %w", link.Attrs().Name, netnsCfg.name, err)
+	}
+
+	return configureNetnsLink(targetNs, n)
+}
+
+// configureNetnsLink sets up addresses, routes, and MTU for the ENI's link
+// once it is inside targetNs. It is safe to call on a link that is already
+// fully configured; existing addresses and routes are left untouched.
+func configureNetnsLink(targetNs netns.NsHandle, n networkInterface) error {
+	return inNetns(targetNs, func() error {
+		link, err := findLinkByMAC(n.macAddress)
+		if err != nil {
+			return err
+		}
+		if link == nil {
+			return fmt.Errorf("link for ENI %q not present in target netns", n.id)
+		}
+
+		if link.Attrs().MTU != n.mtu && n.mtu > 0 {
+			if err := netlink.LinkSetMTU(link, n.mtu); err != nil {
+				return fmt.Errorf("setting MTU on %q: %w", link.Attrs().Name, err)
+			}
+		}
+
+		if err := netlink.LinkSetUp(link); err != nil {
+			return fmt.Errorf("bringing up %q: %w", link.Attrs().Name, err)
+		}
+
+		for _, addr := range n.addresses {
+			nlAddr, err := netlink.ParseAddr(addr)
+			if err != nil {
+				return fmt.Errorf("parsing address %q: %w", addr, err)
+			}
+			if hasAddr(link, nlAddr) {
+				continue
+			}
+			if err := netlink.AddrAdd(link, nlAddr); err != nil {
+				return fmt.Errorf("adding address %q to %q: %w", addr, link.Attrs().Name, err)
+			}
+		}
+
+		if netnsCfg.defaultRoute != "" {
+			gw := net.ParseIP(netnsCfg.defaultRoute)
+			if gw == nil {
+				return fmt.Errorf("invalid --netns-default-route %q", netnsCfg.defaultRoute)
+			}
+			route := &netlink.Route{LinkIndex: link.Attrs().Index, Gw: gw}
+			if !hasDefaultRoute(link, gw) {
+				if err := netlink.RouteAdd(route); err != nil {
+					return fmt.Errorf("adding default route via %q: %w", gw, err)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// restoreNetns moves the ENI's link back to the root namespace, used on
+// detach. If the link is not found in the target namespace this is a no-op,
+// since the ENI may already be in the process of disappearing.
+func restoreNetns(n networkInterface) error {
+	if !netnsCfg.move {
+		return nil
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	rootNs, err := netns.Get()
+	if err != nil {
+		return fmt.Errorf("getting root netns: %w", err)
+	}
+	defer rootNs.Close()
+
+	targetNs, err := netns.GetFromName(netnsCfg.name)
+	if err != nil {
+		return nil
+	}
+	defer targetNs.Close()
+
+	var link netlink.Link
+	err = inNetns(targetNs, func() error {
+		var err error
+		link, err = findLinkByMAC(n.macAddress)
+		return err
+	})
+	if err != nil || link == nil {
+		return err
+	}
+
+	return inNetns(targetNs, func() error {
+		return netlink.LinkSetNsFd(link, int(rootNs))
+	})
+}
+
+// ensureNetns returns a handle to the named netns, creating it if it does
+// not already exist.
+func ensureNetns(name string) (netns.NsHandle, error) {
+	ns, err := netns.GetFromName(name)
+	if err == nil {
+		return ns, nil
+	}
+	return netns.NewNamed(name)
+}
+
+// inNetns runs fn with the calling goroutine's thread switched into ns,
+// restoring the original namespace afterwards.
+func inNetns(ns netns.NsHandle, fn func() error) error {
+	origin, err := netns.Get()
+	if err != nil {
+		return err
+	}
+	defer origin.Close()
+
+	if err := netns.Set(ns); err != nil {
+		return fmt.Errorf("switching into netns: %w", err)
+	}
+	defer netns.Set(origin)
+
+	return fn()
+}
+
+// findLinkByMAC returns the link in the current namespace whose hardware
+// address matches mac, or nil if none is found.
+func findLinkByMAC(mac string) (netlink.Link, error) {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		if link.Attrs().HardwareAddr.String() == mac {
+			return link, nil
+		}
+	}
+	return nil, nil
+}
+
+// linkExistsInNetns reports whether a link matching mac already exists
+// inside the named netns.
+func linkExistsInNetns(name, mac string) (bool, error) {
+	ns, err := netns.GetFromName(name)
+	if err != nil {
+		return false, err
+	}
+	defer ns.Close()
+
+	var found netlink.Link
+	err = inNetns(ns, func() error {
+		var err error
+		found, err = findLinkByMAC(mac)
+		return err
+	})
+	return found != nil, err
+}
+
+func hasAddr(link netlink.Link, addr *netlink.Addr) bool {
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if a.Equal(*addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasDefaultRoute(link netlink.Link, gw net.IP) bool {
+	routes, err := netlink.RouteList(link, netlink.FAMILY_ALL)
+	if err != nil {
+		return false
+	}
+	for _, r := range routes {
+		if r.Dst == nil && r.Gw.Equal(gw) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// overlayOpts holds the flags that control mounting an overlayfs on top of
+// the attached EBS volume once it is formatted and mounted.
+type overlayOpts struct {
+	enabled   bool
+	lowerDir  string
+	upperDir  string
+	workDir   string
+	mergedDir string
+}
+
+var overlayCfg overlayOpts
+
+func init() {
+	flag.BoolVar(&overlayCfg.enabled, "overlay", false, "whether to mount an overlayfs with upperdir/workdir on the attached volume")
+	flag.StringVar(&overlayCfg.lowerDir, "overlay-lowerdir", "", "read-only lowerdir for the overlay, e.g. a container rootfs or app install dir")
+	flag.StringVar(&overlayCfg.upperDir, "overlay-upperdir", "", "writable upperdir for the overlay; defaults to <mount-point>/upper")
+	flag.StringVar(&overlayCfg.workDir, "overlay-workdir", "", "workdir for the overlay; defaults to <mount-point>/work")
+	flag.StringVar(&overlayCfg.mergedDir, "overlay-merged", "", "merged mountpoint for the overlay; defaults to <mount-point>/merged")
+}
+
+// mountOverlay mounts an overlayfs whose lowerdir is a host path and whose
+// upperdir/workdir live on the already-mounted EBS volume, so that a
+// writable layer survives failover to another instance. It is a no-op if
+// the overlay is already mounted at the merged directory.
+func mountOverlay() error {
+	if !overlayCfg.enabled {
+		return nil
+	}
+	if overlayCfg.lowerDir == "" {
+		return fmt.Errorf("--overlay-lowerdir must be set when --overlay is enabled")
+	}
+
+	upper := overlayUpperDir()
+	work := overlayWorkDir()
+	merged := overlayMergedDir()
+
+	for _, dir := range []string{upper, work, merged} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("creating overlay directory %q: %w", dir, err)
+		}
+	}
+
+	if mounted, err := isMounted(merged); err != nil {
+		return fmt.Errorf("checking mount state of %q: %w", merged, err)
+	} else if mounted {
+		return nil
+	}
+
+	opts := fmt.Sprintf("lowerdir=%s,upperdir=%s,workdir=%s", overlayCfg.lowerDir, upper, work)
+	if err := syscall.Mount("overlay", merged, "overlay", 0, opts); err != nil {
+		return fmt.Errorf("mounting overlay at %q: %w", merged, err)
+	}
+
+	return nil
+}
+
+// unmountOverlay unmounts the overlay, followed by the backing file system
+// at --mount-point, in that order so the kernel never sees upperdir/workdir
+// disappear out from under a mounted overlay.
+func unmountOverlay() error {
+	if !overlayCfg.enabled {
+		return unmountFs(opts.mountPoint)
+	}
+
+	merged := overlayMergedDir()
+	if mounted, err := isMounted(merged); err != nil {
+		return fmt.Errorf("checking mount state of %q: %w", merged, err)
+	} else if mounted {
+		if err := syscall.Unmount(merged, 0); err != nil {
+			return fmt.Errorf("unmounting overlay at %q: %w", merged, err)
+		}
+	}
+
+	return unmountFs(opts.mountPoint)
+}
+
+func overlayUpperDir() string {
+	if overlayCfg.upperDir != "" {
+		return overlayCfg.upperDir
+	}
+	return filepath.Join(opts.mountPoint, "upper")
+}
+
+func overlayWorkDir() string {
+	if overlayCfg.workDir != "" {
+		return overlayCfg.workDir
+	}
+	return filepath.Join(opts.mountPoint, "work")
+}
+
+func overlayMergedDir() string {
+	if overlayCfg.mergedDir != "" {
+		return overlayCfg.mergedDir
+	}
+	// Must not be mountPoint itself: upperdir/workdir default to
+	// subdirectories of mountPoint, and the kernel rejects an overlay whose
+	// upperdir/workdir are descendants of its own merged directory.
+	return filepath.Join(opts.mountPoint, "merged")
+}
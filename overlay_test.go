@@ -0,0 +1,51 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOverlayDirDefaults(t *testing.T) {
+	orig := overlayCfg
+	defer func() { overlayCfg = orig }()
+	overlayCfg = overlayOpts{}
+	opts.mountPoint = "/data"
+
+	upper := overlayUpperDir()
+	work := overlayWorkDir()
+	merged := overlayMergedDir()
+
+	if upper != filepath.Join("/data", "upper") {
+		t.Errorf("overlayUpperDir() = %q", upper)
+	}
+	if work != filepath.Join("/data", "work") {
+		t.Errorf("overlayWorkDir() = %q", work)
+	}
+	if merged == opts.mountPoint {
+		t.Fatalf("overlayMergedDir() must not default to --mount-point, got %q", merged)
+	}
+	if strings.HasPrefix(upper, merged+"/") || strings.HasPrefix(work, merged+"/") {
+		t.Errorf("upperdir/workdir must not be descendants of merged dir %q: upper=%q work=%q", merged, upper, work)
+	}
+}
+
+func TestOverlayDirOverrides(t *testing.T) {
+	orig := overlayCfg
+	defer func() { overlayCfg = orig }()
+	overlayCfg = overlayOpts{
+		upperDir:  "/custom/upper",
+		workDir:   "/custom/work",
+		mergedDir: "/custom/merged",
+	}
+
+	if got := overlayUpperDir(); got != "/custom/upper" {
+		t.Errorf("overlayUpperDir() = %q", got)
+	}
+	if got := overlayWorkDir(); got != "/custom/work" {
+		t.Errorf("overlayWorkDir() = %q", got)
+	}
+	if got := overlayMergedDir(); got != "/custom/merged" {
+		t.Errorf("overlayMergedDir() = %q", got)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shutdownTimeout bounds how long a graceful shutdown waits for the volume
+// and network interface to detach before giving up.
+const shutdownTimeout = 2 * time.Minute
+
+// leaseDuration is how long a lease acquired via AcquireLease remains valid
+// before a peer is allowed to consider it stale.
+const leaseDuration = 2 * time.Minute
+
+// shutdown unmounts the overlay/file system and detaches the volume and
+// network interface currently held by i, releasing the lease along the way.
+// It is called once, on receipt of SIGINT/SIGTERM.
+func shutdown(ctx context.Context, i *instance, cloud CloudProvider) error {
+	if err := unmountOverlay(); err != nil {
+		log.Println(err)
+	}
+
+	if i.volume != nil {
+		if err := waitForVolumeDetach(ctx, i, *i.volume, cloud); err != nil {
+			return fmt.Errorf("detaching volume %q: %w", i.volume.id, err)
+		}
+		if err := cloud.ReleaseLease(ctx, i, *i.volume); err != nil {
+			log.Println(err)
+		}
+		i.volume = nil
+	}
+
+	if i.networkInterface != nil {
+		if err := restoreNetns(*i.networkInterface); err != nil {
+			log.Println(err)
+		}
+		if err := cloud.DetachNICExtras(ctx, *i.networkInterface); err != nil {
+			log.Println(err)
+		}
+		if err := cloud.DetachNIC(ctx, i, *i.networkInterface); err != nil {
+			return fmt.Errorf("detaching network interface %q: %w", i.networkInterface.id, err)
+		}
+		i.networkInterface = nil
+	}
+
+	return nil
+}
+
+// waitForVolumeDetach issues DetachVolume and blocks, via the CloudProvider,
+// until the volume reports available or the context expires.
+func waitForVolumeDetach(ctx context.Context, i *instance, v volume, cloud CloudProvider) error {
+	if err := cloud.DetachVolume(ctx, i, v); err != nil {
+		return err
+	}
+	return cloud.WaitVolumeAvailable(ctx, v)
+}
+
+// formatHolderTag renders the lease tag/metadata value for instanceID
+// holding the lease until until.
+func formatHolderTag(instanceID string, until time.Time) string {
+	return fmt.Sprintf("%s,lease-until=%d", instanceID, until.Unix())
+}
+
+// parseHolderTag parses a lease tag/metadata value of the form
+// "<instance-id>,lease-until=<unix-ts>". An empty tag value yields a zero
+// holder and lease, meaning the volume is unclaimed.
+func parseHolderTag(tag string) (holder string, leaseUntil time.Time, err error) {
+	if tag == "" {
+		return "", time.Time{}, nil
+	}
+
+	parts := strings.SplitN(tag, ",lease-until=", 2)
+	if len(parts) != 2 {
+		return "", time.Time{}, fmt.Errorf("malformed holder tag %q", tag)
+	}
+
+	ts, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("malformed lease-until in holder tag %q: %w", tag, err)
+	}
+
+	return parts[0], time.Unix(ts, 0), nil
+}
+
+// holderStillValid reports whether tag records a lease held by someone
+// other than instanceID that has not yet expired.
+func holderStillValid(tag, instanceID string) (bool, string, error) {
+	holder, leaseUntil, err := parseHolderTag(tag)
+	if err != nil {
+		return false, "", err
+	}
+	return holder != "" && holder != instanceID && time.Now().Before(leaseUntil), holder, nil
+}
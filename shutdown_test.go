@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatAndParseHolderTag(t *testing.T) {
+	until := time.Unix(1700000000, 0)
+	tag := formatHolderTag("i-1234", until)
+
+	holder, leaseUntil, err := parseHolderTag(tag)
+	if err != nil {
+		t.Fatalf("parseHolderTag(%q) returned error: %s", tag, err)
+	}
+	if holder != "i-1234" {
+		t.Errorf("holder = %q, want %q", holder, "i-1234")
+	}
+	if !leaseUntil.Equal(until) {
+		t.Errorf("leaseUntil = %v, want %v", leaseUntil, until)
+	}
+}
+
+func TestParseHolderTagEmpty(t *testing.T) {
+	holder, leaseUntil, err := parseHolderTag("")
+	if err != nil {
+		t.Fatalf("parseHolderTag(\"\") returned error: %s", err)
+	}
+	if holder != "" || !leaseUntil.IsZero() {
+		t.Errorf("parseHolderTag(\"\") = (%q, %v), want zero values", holder, leaseUntil)
+	}
+}
+
+func TestParseHolderTagMalformed(t *testing.T) {
+	cases := []string{"i-1234", "i-1234,lease-until=notanumber"}
+	for _, tag := range cases {
+		if _, _, err := parseHolderTag(tag); err == nil {
+			t.Errorf("parseHolderTag(%q) expected error, got nil", tag)
+		}
+	}
+}
+
+func TestHolderStillValid(t *testing.T) {
+	future := formatHolderTag("i-other", time.Now().Add(time.Minute))
+	past := formatHolderTag("i-other", time.Now().Add(-time.Minute))
+	mine := formatHolderTag("i-mine", time.Now().Add(time.Minute))
+
+	cases := []struct {
+		name string
+		tag  string
+		want bool
+	}{
+		{"empty tag is unclaimed", "", false},
+		{"other holder with live lease blocks", future, true},
+		{"other holder with expired lease does not block", past, false},
+		{"own holder never blocks", mine, false},
+	}
+
+	for _, c := range cases {
+		held, _, err := holderStillValid(c.tag, "i-mine")
+		if err != nil {
+			t.Fatalf("%s: holderStillValid returned error: %s", c.name, err)
+		}
+		if held != c.want {
+			t.Errorf("%s: holderStillValid(%q) = %v, want %v", c.name, c.tag, held, c.want)
+		}
+	}
+}